@@ -2,39 +2,406 @@ package main
 
 // Proxy for opening local files in the explorer/finder via link from the browser
 // run as:
-// go run .\proxy.go -base C:\Users\Sophie\SomeFolder -token foo -port 1234
+// go run .\proxy.go -root main=C:\Users\Sophie\SomeFolder -token foo -port 1234
 // and put a link onto a website:
-// http://localhost:1234/open?name=subDir&token=foo
+// http://localhost:1234/open?root=main&name=subDir&token=foo
 // when the link is clicked (fetched by the browser) the subDir is open in the explorer locally
+//
+// -root is repeatable (name=path) so one proxy instance can serve several
+// project trees; every request must name the root it wants via ?root=.
+//
+// ?mode= selects the action taken once name resolves:
+//   - open   (default) opens a directory in the file manager, unless -launch-config
+//     matches the file's name to a launcher command, in which case that runs instead
+//   - reveal selects the file/dir inside the file manager instead of just opening its parent
+//   - edit   launches the configured editor (-editor or $EDITOR) on the file
+//
+// -launch-config points at a JSON file of {"pattern","command","args"} objects,
+// first glob match wins; command/args may use {path}/{line}/{col} placeholders.
+// -dry-run logs the resolved command instead of running it.
+//
+// /browse/<root>/<subpath> lists directories and /file/<root>/<subpath> streams
+// a single file, both read-only and token-gated, for browser-side previewing
+// before an /open is triggered.
+//
+// -hmac-key switches auth from the shared ?token= to signed, time-limited
+// URLs: ?sig=<hex>&exp=<unix>, where sig is HMAC-SHA256 over
+// "method|path|root|name|mode|exp" keyed by -hmac-key; expired sigs are always
+// rejected, and -hmac-replay-guard additionally rejects a sig once it's been
+// seen before (/watch is exempt, since a reconnecting SSE client legitimately
+// reissues the same URL). -allow-origin (repeatable) restricts Origin/Referer
+// (reduced to scheme://host) on the gated endpoints and adds CORS preflight
+// handling.
+//
+// /status?root=&name=&glob= returns the same exists/match information as
+// /test but as JSON, for callers that want data instead of an SVG badge.
+// /watch?root=&name= is a Server-Sent-Events stream of create/modify/delete
+// events under that directory, built on fsnotify with a debounced,
+// reference-counted watcher per path so multiple subscribers share one
+// underlying watch.
+//
+// All of the above resolve ?name= through resolvePath, which evaluates
+// symlinks on the final path so one can't be used to escape basePath, and
+// checks it against the repeatable -deny/-allow glob lists (-allow wins,
+// -deny defaults to nothing denied).
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
-var basePath string
+var roots = rootsFlag{}
 var port string
 var token string
+var editor string
+var launchConfigPath string
+var dryRun bool
+var launchRules []launchRule
+var hmacKey string
+var replayGuard bool
+var allowOrigins stringsFlag
+var denyPatterns stringsFlag
+var allowPatterns stringsFlag
 
-func HasFileWithPrefixExceptExt(dir, prefix, excludeExt string) (bool, error) {
+// rootsFlag collects repeatable -root name=path flags into a name -> absolute
+// path lookup table.
+type rootsFlag map[string]string
+
+func (r rootsFlag) String() string {
+	parts := make([]string, 0, len(r))
+	for name, path := range r {
+		parts = append(parts, name+"="+path)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r rootsFlag) Set(value string) error {
+	name, path, ok := strings.Cut(value, "=")
+	if !ok || name == "" || path == "" {
+		return fmt.Errorf("invalid -root value %q, expected name=path", value)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("resolving root %q: %w", name, err)
+	}
+	r[name] = abs
+	return nil
+}
+
+// resolveRoot looks up the base directory registered under rootName,
+// rejecting requests for roots that were never passed via -root.
+func resolveRoot(rootName string) (string, error) {
+	path, ok := roots[rootName]
+	if !ok {
+		return "", fmt.Errorf("unknown root: %s", rootName)
+	}
+	return path, nil
+}
+
+// stringsFlag collects a repeatable string flag, e.g. -allow-origin.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+var nonceMu sync.Mutex
+var seenNonces = map[string]int64{}
+
+// nonceSeen reports whether sig has already been used within its validity
+// window and records it if not, so a signed URL cannot be replayed.
+func nonceSeen(sig string, exp int64) bool {
+	nonceMu.Lock()
+	defer nonceMu.Unlock()
+
+	now := time.Now().Unix()
+	for s, e := range seenNonces {
+		if e < now {
+			delete(seenNonces, s)
+		}
+	}
+
+	if _, ok := seenNonces[sig]; ok {
+		return true
+	}
+	seenNonces[sig] = exp
+	return false
+}
+
+// signURL computes the hex HMAC over method|path|root|name|mode|exp,
+// matching what verifySignedURL expects in ?sig=. root and mode are
+// included so a signature can't be replayed against a different root or a
+// more privileged mode (e.g. swapping mode=reveal for mode=edit).
+func signURL(method, path, root, name, mode string, exp int64) string {
+	mac := hmac.New(sha256.New, []byte(hmacKey))
+	fmt.Fprintf(mac, "%s|%s|%s|%s|%s|%d", method, path, root, name, mode, exp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignedURL checks ?sig=&exp= against the -hmac-key, rejecting expired
+// URLs. checkReplay additionally rejects a sig that's already been used,
+// gated on -hmac-replay-guard; long-lived/reconnecting endpoints like /watch
+// pass false so a browser's automatic EventSource reconnect (which reissues
+// the identical signed URL) isn't treated as a replay attack.
+func verifySignedURL(r *http.Request, checkReplay bool) bool {
+	q := r.URL.Query()
+	sig := q.Get("sig")
+	expStr := q.Get("exp")
+	if sig == "" || expStr == "" {
+		return false
+	}
+
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+
+	expected := signURL(r.Method, r.URL.Path, q.Get("root"), q.Get("name"), q.Get("mode"), exp)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return false
+	}
+
+	if checkReplay && replayGuard && nonceSeen(sig, exp) {
+		return false
+	}
+	return true
+}
+
+// authOK checks the request against whichever auth mode is configured:
+// HMAC-signed URLs if -hmac-key is set, otherwise the shared ?token=.
+func authOK(r *http.Request, checkReplay bool) bool {
+	if hmacKey != "" {
+		return verifySignedURL(r, checkReplay)
+	}
+	return token == "" || token == r.URL.Query().Get("token")
+}
+
+// refererOrigin reduces a Referer header (a full URL) down to its
+// scheme://host[:port] so it can be compared against -allow-origin entries,
+// which are bare origins like a real Origin header would send.
+func refererOrigin(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// originAllowed reports whether origin may call the gated endpoints. An
+// empty -allow-origin list means no restriction.
+func originAllowed(origin string) bool {
+	if len(allowOrigins) == 0 {
+		return true
+	}
+	for _, o := range allowOrigins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// withAuth wraps a handler with CORS preflight handling, Origin/Referer
+// allow-listing and the configured auth check, in that order.
+func withAuth(next http.HandlerFunc) http.HandlerFunc {
+	return withAuthReplay(next, true)
+}
+
+// withAuthReplay is withAuth with control over whether a signed URL's replay
+// guard applies. Pass false for endpoints a client legitimately re-requests
+// with the same URL, such as /watch's SSE stream on reconnect.
+func withAuthReplay(next http.HandlerFunc, checkReplay bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			origin = refererOrigin(r.Header.Get("Referer"))
+		}
+		if len(allowOrigins) > 0 {
+			if !originAllowed(origin) {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !authOK(r, checkReplay) {
+			http.Error(w, "Invalid Token", http.StatusBadRequest)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// globSegmentsMatch matches path segments against pattern segments, treating
+// a lone "**" pattern segment as "any number of path segments" so patterns
+// like "**/.git" can deny a directory at any depth.
+func globSegmentsMatch(patSegs, nameSegs []string) bool {
+	if len(patSegs) == 0 {
+		return len(nameSegs) == 0
+	}
+	if patSegs[0] == "**" {
+		if globSegmentsMatch(patSegs[1:], nameSegs) {
+			return true
+		}
+		if len(nameSegs) == 0 {
+			return false
+		}
+		return globSegmentsMatch(patSegs, nameSegs[1:])
+	}
+	if len(nameSegs) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(patSegs[0], nameSegs[0]); !ok {
+		return false
+	}
+	return globSegmentsMatch(patSegs[1:], nameSegs[1:])
+}
+
+// globMatchesPath reports whether rel (slash-separated, root-relative)
+// matches pattern, supporting "**" path segments in addition to the usual
+// filepath.Match wildcards.
+func globMatchesPath(pattern, rel string) bool {
+	return globSegmentsMatch(strings.Split(pattern, "/"), strings.Split(filepath.ToSlash(rel), "/"))
+}
+
+// nameDenied checks rel (root-relative, slash-separated) against -deny,
+// with -allow entries taking precedence so a broad deny can be punched
+// through for specific paths.
+func nameDenied(rel string) bool {
+	for _, pat := range allowPatterns {
+		if globMatchesPath(pat, rel) {
+			return false
+		}
+	}
+	for _, pat := range denyPatterns {
+		if globMatchesPath(pat, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalizeAncestor resolves symlinks in path even when path itself
+// doesn't exist yet: it walks up to the deepest ancestor that does exist,
+// runs EvalSymlinks on that, and re-appends the non-existent suffix.
+// Without this, a non-existent path skips symlink resolution entirely,
+// which both rejects legitimate not-found lookups under a symlinked base
+// and lets a symlink escape go unnoticed as long as the final name is new.
+func canonicalizeAncestor(path string) (string, error) {
+	suffix := ""
+	cur := path
+	for {
+		if _, err := os.Lstat(cur); err == nil {
+			resolved, err := filepath.EvalSymlinks(cur)
+			if err != nil {
+				return "", err
+			}
+			if suffix == "" {
+				return resolved, nil
+			}
+			return filepath.Join(resolved, suffix), nil
+		}
+
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return path, nil
+		}
+		if suffix == "" {
+			suffix = filepath.Base(cur)
+		} else {
+			suffix = filepath.Join(filepath.Base(cur), suffix)
+		}
+		cur = parent
+	}
+}
+
+// resolvePath resolves name under basePath, rejecting absolute names,
+// -deny-listed names, and symlinks that would resolve outside of basePath
+// once both sides are canonicalized, including the parts of the path that
+// don't exist on disk yet.
+func resolvePath(basePath, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("absolute paths are not allowed: %s", name)
+	}
+
+	cleanSub := filepath.Clean(string(filepath.Separator) + name)
+	rel := strings.TrimPrefix(cleanSub, string(filepath.Separator))
+	if nameDenied(rel) {
+		return "", fmt.Errorf("path denied: %s", name)
+	}
+
+	full := filepath.Join(basePath, cleanSub)
+
+	canonicalBase, err := filepath.EvalSymlinks(basePath)
+	if err != nil {
+		return "", fmt.Errorf("resolving base: %w", err)
+	}
+
+	resolved, err := canonicalizeAncestor(full)
+	if err != nil {
+		return "", fmt.Errorf("resolving path: %w", err)
+	}
+
+	if resolved != canonicalBase && !strings.HasPrefix(resolved, canonicalBase+string(filepath.Separator)) {
+		return "", fmt.Errorf("path escapes root: %s", name)
+	}
+
+	return full, nil
+}
+
+// filesWithPrefixExceptExt returns the files under dir matching the prefix
+// glob, excluding any whose name ends in excludeExt.
+func filesWithPrefixExceptExt(dir, prefix, excludeExt string) ([]string, error) {
 	pattern := filepath.Join(dir, prefix)
 	files, err := filepath.Glob(pattern)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
+	matched := files[:0]
 	for _, f := range files {
 		if !strings.HasSuffix(f, excludeExt) {
-			return true, nil
+			matched = append(matched, f)
 		}
 	}
-	return false, nil
+	return matched, nil
+}
+
+func HasFileWithPrefixExceptExt(dir, prefix, excludeExt string) (bool, error) {
+	files, err := filesWithPrefixExceptExt(dir, prefix, excludeExt)
+	if err != nil {
+		return false, err
+	}
+	return len(files) > 0, nil
 }
 
 func openPath(path string) error {
@@ -53,90 +420,411 @@ func openPath(path string) error {
 	return cmd.Start()
 }
 
+// revealPath asks the OS file manager to select path rather than just
+// opening its containing directory. Windows and macOS both support this
+// natively; on Linux we try the select flag of a few common file managers
+// before falling back to plain xdg-open on the parent directory.
+func revealPath(path string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("explorer", "/select,"+path)
+	case "darwin":
+		cmd = exec.Command("open", "-R", path)
+	default:
+		dir := filepath.Dir(path)
+		for _, fm := range []struct {
+			bin  string
+			args []string
+		}{
+			{"nautilus", []string{"--select", path}},
+			{"dolphin", []string{"--select", path}},
+			{"nemo", []string{path}},
+		} {
+			if _, err := exec.LookPath(fm.bin); err == nil {
+				cmd = exec.Command(fm.bin, fm.args...)
+				break
+			}
+		}
+		if cmd == nil {
+			cmd = exec.Command("xdg-open", dir)
+		}
+	}
+
+	return cmd.Start()
+}
+
+// editPath launches the configured editor on path, using the -editor flag
+// if set and falling back to $EDITOR otherwise.
+func editPath(path string) error {
+	ed := editor
+	if ed == "" {
+		ed = os.Getenv("EDITOR")
+	}
+	if ed == "" {
+		return fmt.Errorf("no editor configured (set -editor or $EDITOR)")
+	}
+
+	cmd := exec.Command(ed, path)
+	return cmd.Start()
+}
+
+// launchRule maps a glob pattern (matched against the file's base name) to a
+// launcher command. Command and Args may contain the placeholders {path},
+// {line} and {col}, substituted with the requested file before exec.
+type launchRule struct {
+	Pattern string   `json:"pattern"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+// loadLaunchConfig reads the -launch-config JSON file, a flat array of
+// launchRule entries matched in order, first match wins.
+func loadLaunchConfig(path string) ([]launchRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []launchRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing launch config: %w", err)
+	}
+	return rules, nil
+}
+
+// findLaunchRule returns the first rule whose pattern matches name's base,
+// or nil if none apply.
+func findLaunchRule(name string) *launchRule {
+	base := filepath.Base(name)
+	for i, rule := range launchRules {
+		if ok, _ := filepath.Match(rule.Pattern, base); ok {
+			return &launchRules[i]
+		}
+	}
+	return nil
+}
+
+func substitutePlaceholders(s, path, line, col string) string {
+	s = strings.ReplaceAll(s, "{path}", path)
+	s = strings.ReplaceAll(s, "{line}", line)
+	s = strings.ReplaceAll(s, "{col}", col)
+	return s
+}
+
+// dispatchLaunch runs the matched rule's command against path, substituting
+// {path}/{line}/{col} placeholders. With -dry-run the resolved command is
+// logged instead of executed.
+func dispatchLaunch(rule launchRule, path, line, col string) error {
+	command := substitutePlaceholders(rule.Command, path, line, col)
+	args := make([]string, len(rule.Args))
+	for i, a := range rule.Args {
+		args[i] = substitutePlaceholders(a, path, line, col)
+	}
+
+	if dryRun {
+		fmt.Printf("[dry-run] would run: %s %s\n", command, strings.Join(args, " "))
+		return nil
+	}
+
+	return exec.Command(command, args...).Start()
+}
+
+// pathStatus is the JSON body returned by /status.
+type pathStatus struct {
+	Exists      bool  `json:"exists"`
+	IsDir       bool  `json:"isDir"`
+	Size        int64 `json:"size"`
+	Mtime       int64 `json:"mtime"`
+	MatchedGlob bool  `json:"matchedGlob"`
+	MatchCount  int   `json:"matchCount"`
+}
+
+// watchEvent is one debounced change streamed by /watch.
+type watchEvent struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+}
+
+// dirWatcher is a single fsnotify watcher shared by every /watch subscriber
+// of a given directory, reference-counted so the last disconnect tears it
+// down.
+type dirWatcher struct {
+	watcher     *fsnotify.Watcher
+	mu          sync.Mutex
+	refCount    int
+	subscribers map[chan watchEvent]struct{}
+	pending     map[string]string
+	flushTimer  *time.Timer
+}
+
+var watchersMu sync.Mutex
+var watchers = map[string]*dirWatcher{}
+
+const watchDebounce = 200 * time.Millisecond
+
+// acquireWatcher returns the shared dirWatcher for path, creating it (and
+// recursively watching every subdirectory) on first use.
+func acquireWatcher(path string) (*dirWatcher, error) {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
+	if dw, ok := watchers[path]; ok {
+		dw.refCount++
+		return dw, nil
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return fw.Add(p)
+	})
+	if err != nil {
+		fw.Close()
+		return nil, err
+	}
+
+	dw := &dirWatcher{
+		watcher:     fw,
+		refCount:    1,
+		subscribers: map[chan watchEvent]struct{}{},
+		pending:     map[string]string{},
+	}
+	watchers[path] = dw
+	go dw.pump()
+	return dw, nil
+}
+
+// releaseWatcher drops one reference to path's watcher, tearing it down once
+// nothing is subscribed anymore.
+func releaseWatcher(path string, dw *dirWatcher) {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
+	dw.refCount--
+	if dw.refCount > 0 {
+		return
+	}
+	delete(watchers, path)
+	dw.watcher.Close()
+}
+
+// pump reads raw fsnotify events and coalesces them per-path before
+// broadcasting, so a burst of writes to one file becomes a single event. A
+// Create event for a directory also adds it (and anything already inside
+// it, e.g. a moved-in tree) to the watch, since fsnotify only watches the
+// directories it's explicitly told about and never recurses on its own.
+func (dw *dirWatcher) pump() {
+	for {
+		select {
+		case ev, ok := <-dw.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				dw.watchIfDir(ev.Name)
+			}
+			dw.mu.Lock()
+			dw.pending[ev.Name] = ev.Op.String()
+			if dw.flushTimer == nil {
+				dw.flushTimer = time.AfterFunc(watchDebounce, dw.flush)
+			}
+			dw.mu.Unlock()
+		case _, ok := <-dw.watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// watchIfDir adds path, and every directory under it, to dw's watcher if
+// path turned out to be a directory. Errors are swallowed: a race where the
+// path disappears again before we can stat/walk it just means there's
+// nothing left to watch.
+func (dw *dirWatcher) watchIfDir(path string) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return
+	}
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		dw.watcher.Add(p)
+		return nil
+	})
+}
+
+// flush sends the pending events to every current subscriber. It holds dw.mu
+// for the whole send, not just the snapshot, so it can never race
+// unsubscribe's close(ch): debounced flushes are infrequent enough that
+// serializing the send is cheap, and it's the only way to guarantee a
+// subscriber channel isn't closed out from under an in-flight send.
+func (dw *dirWatcher) flush() {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+
+	pending := dw.pending
+	dw.pending = map[string]string{}
+	dw.flushTimer = nil
+
+	for path, op := range pending {
+		ev := watchEvent{Path: path, Op: op}
+		for ch := range dw.subscribers {
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+}
+
+func (dw *dirWatcher) subscribe() chan watchEvent {
+	ch := make(chan watchEvent, 16)
+	dw.mu.Lock()
+	dw.subscribers[ch] = struct{}{}
+	dw.mu.Unlock()
+	return ch
+}
+
+func (dw *dirWatcher) unsubscribe(ch chan watchEvent) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	delete(dw.subscribers, ch)
+	close(ch)
+}
+
 func main() {
-	flag.StringVar(&basePath, "base", ".", "Base directory for allowed paths (required)")
+	flag.Var(&roots, "root", "Named root directory as name=path (repeatable, required)")
 	flag.StringVar(&port, "port", "4455", "Port to listen on")
 	flag.StringVar(&token, "token", "", "Secret token to check for (&token=...) in request")
+	flag.StringVar(&editor, "editor", "", "Editor command for mode=edit (defaults to $EDITOR)")
+	flag.StringVar(&launchConfigPath, "launch-config", "", "JSON file mapping glob patterns to launcher commands")
+	flag.BoolVar(&dryRun, "dry-run", false, "Log the launch command instead of executing it")
+	flag.StringVar(&hmacKey, "hmac-key", "", "HMAC key for signed, time-limited URLs (replaces -token)")
+	flag.BoolVar(&replayGuard, "hmac-replay-guard", false, "Reject a signed URL that's already been used once (-hmac-key only)")
+	flag.Var(&allowOrigins, "allow-origin", "Allowed Origin/Referer for gated endpoints (repeatable, default: allow all)")
+	flag.Var(&denyPatterns, "deny", "Glob pattern (supports ** segments) of root-relative paths to reject, e.g. **/.git (repeatable)")
+	flag.Var(&allowPatterns, "allow", "Glob pattern that overrides -deny for matching paths (repeatable)")
 	flag.Parse()
 
-	abs, err := filepath.Abs(basePath)
-	if err != nil {
-		fmt.Println("Error resolving base path:", err)
+	if len(roots) == 0 {
+		fmt.Println("Error: at least one -root name=path must be given")
 		os.Exit(1)
 	}
-	basePath = abs
-	info, err := os.Stat(basePath)
-	if os.IsNotExist(err) {
-		fmt.Println("Error: base path does not exist:", basePath)
-		os.Exit(1)
-	}
-	if err != nil {
-		fmt.Println("Error checking base path:", err)
-		os.Exit(1)
+
+	if launchConfigPath != "" {
+		rules, err := loadLaunchConfig(launchConfigPath)
+		if err != nil {
+			fmt.Println("Error loading launch config:", err)
+			os.Exit(1)
+		}
+		launchRules = rules
 	}
-	if !info.IsDir() {
-		fmt.Println("Error: base path is not a directory:", basePath)
-		os.Exit(1)
+
+	for name, path := range roots {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			fmt.Printf("Error: root %q does not exist: %s\n", name, path)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Printf("Error checking root %q: %v\n", name, err)
+			os.Exit(1)
+		}
+		if !info.IsDir() {
+			fmt.Printf("Error: root %q is not a directory: %s\n", name, path)
+			os.Exit(1)
+		}
 	}
 
-	http.HandleFunc("/open", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/open", withAuth(func(w http.ResponseWriter, r *http.Request) {
 		name := r.URL.Query().Get("name")
-		givenToken := r.URL.Query().Get("token")
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = "open"
+		}
 		if name == "" {
 			http.Error(w, "Missing ?name= parameter", http.StatusBadRequest)
 			return
 		}
-		if token != "" && token != givenToken {
-			http.Error(w, "Invalid Token", http.StatusBadRequest)
+		if mode != "open" && mode != "reveal" && mode != "edit" {
+			http.Error(w, "Invalid ?mode= parameter", http.StatusBadRequest)
 			return
 		}
 
-		cleanName := filepath.Clean(name)
-		if filepath.IsAbs(name) {
-			fmt.Printf("Base path: %s\n", cleanName)
-			fmt.Printf("Base path: %s\n", name)
+		basePath, err := resolveRoot(r.URL.Query().Get("root"))
+		if err != nil {
+			http.Error(w, "Unknown ?root=", http.StatusBadRequest)
+			return
+		}
+
+		fullPath, err := resolvePath(basePath, name)
+		if err != nil {
 			http.Error(w, "Invalid folder/file name", http.StatusBadRequest)
 			return
 		}
 
-		fullPath := filepath.Join(basePath, cleanName)
 		info, err := os.Stat(fullPath)
+		if err != nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
 
-		if err != nil || !info.IsDir() {
+		var rule *launchRule
+		if mode == "open" {
+			rule = findLaunchRule(fullPath)
+		}
+		if mode == "open" && !info.IsDir() && rule == nil {
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
 
-		if err := openPath(fullPath); err != nil {
+		switch {
+		case rule != nil:
+			err = dispatchLaunch(*rule, fullPath, r.URL.Query().Get("line"), r.URL.Query().Get("col"))
+		case mode == "reveal":
+			err = revealPath(fullPath)
+		case mode == "edit":
+			err = editPath(fullPath)
+		default:
+			err = openPath(fullPath)
+		}
+		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to open: %v", err), http.StatusInternalServerError)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
-	})
+	}))
 
-	http.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/test", withAuth(func(w http.ResponseWriter, r *http.Request) {
 		name := r.URL.Query().Get("name")
 		glob := r.URL.Query().Get("glob")
-		givenToken := r.URL.Query().Get("token")
 		if name == "" {
 			http.Error(w, "Missing ?name= parameter", http.StatusBadRequest)
 			return
 		}
-		if token != "" && token != givenToken {
-			http.Error(w, "Invalid Token", http.StatusBadRequest)
+
+		basePath, err := resolveRoot(r.URL.Query().Get("root"))
+		if err != nil {
+			http.Error(w, "Unknown ?root=", http.StatusBadRequest)
 			return
 		}
 
-		cleanName := filepath.Clean(name)
-		if filepath.IsAbs(name) {
-			fmt.Printf("Base path: %s\n", cleanName)
-			fmt.Printf("Base path: %s\n", name)
+		fullPath, err := resolvePath(basePath, name)
+		if err != nil {
 			http.Error(w, "Invalid folder/file name", http.StatusBadRequest)
 			return
 		}
 		svgTpl := "<svg viewBox='0 0 16 16' xmlns='http://www.w3.org/2000/svg' font-family='monospace'><rect width='16' height='16' fill='%s' /><text x='1' y='12'>%s</text></svg>"
-		fullPath := filepath.Join(basePath, cleanName)
-		_, err := os.Stat(fullPath)
+		_, err = os.Stat(fullPath)
 		if err != nil {
 			w.Header().Add("Content-Type", "image/svg+xml")
 			w.WriteHeader(http.StatusOK)
@@ -171,28 +859,178 @@ func main() {
 				return
 			}
 		}
-	})
-	http.HandleFunc("/style", func(w http.ResponseWriter, r *http.Request) {
+	}))
+	http.HandleFunc("/style", withAuth(func(w http.ResponseWriter, r *http.Request) {
 		class := r.URL.Query().Get("class")
-		givenToken := r.URL.Query().Get("token")
 		if class == "" {
 			http.Error(w, "Missing ?class= parameter", http.StatusBadRequest)
 			return
 		}
-		if token != "" && token != givenToken {
-			http.Error(w, "Invalid Token", http.StatusBadRequest)
-			return
-		}
 		w.Header().Add("Content-Type", "text/css")
 		w.WriteHeader(http.StatusOK)
 		cssTpl := ".%s { display: initial !important; }"
 
 		fmt.Fprintf(w, cssTpl, class)
-	})
+	}))
+
+	http.HandleFunc("/browse/", withAuth(func(w http.ResponseWriter, r *http.Request) {
+		rootName, subPath, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/browse/"), "/")
+		basePath, err := resolveRoot(rootName)
+		if err != nil {
+			http.Error(w, "Unknown root", http.StatusNotFound)
+			return
+		}
+		if _, err := resolvePath(basePath, subPath); err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		urlCopy := *r.URL
+		urlCopy.Path = "/" + subPath
+		r2 := *r
+		r2.URL = &urlCopy
+		http.FileServer(http.Dir(basePath)).ServeHTTP(w, &r2)
+	}))
 
-	fmt.Printf("Base path: %s\n", basePath)
+	http.HandleFunc("/file/", withAuth(func(w http.ResponseWriter, r *http.Request) {
+		rootName, subPath, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/file/"), "/")
+		if !ok || subPath == "" {
+			http.Error(w, "Missing file path", http.StatusBadRequest)
+			return
+		}
+		basePath, err := resolveRoot(rootName)
+		if err != nil {
+			http.Error(w, "Unknown root", http.StatusNotFound)
+			return
+		}
+		fullPath, err := resolvePath(basePath, subPath)
+		if err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		f, err := os.Open(fullPath)
+		if err != nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	}))
+
+	http.HandleFunc("/status", withAuth(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		glob := r.URL.Query().Get("glob")
+		if name == "" {
+			http.Error(w, "Missing ?name= parameter", http.StatusBadRequest)
+			return
+		}
+
+		basePath, err := resolveRoot(r.URL.Query().Get("root"))
+		if err != nil {
+			http.Error(w, "Unknown ?root=", http.StatusBadRequest)
+			return
+		}
+
+		fullPath, err := resolvePath(basePath, name)
+		if err != nil {
+			http.Error(w, "Invalid folder/file name", http.StatusBadRequest)
+			return
+		}
+
+		var status pathStatus
+		if info, err := os.Stat(fullPath); err == nil {
+			status.Exists = true
+			status.IsDir = info.IsDir()
+			status.Size = info.Size()
+			status.Mtime = info.ModTime().Unix()
+		}
+		if status.Exists && glob != "" {
+			matches, err := filesWithPrefixExceptExt(fullPath, filepath.Base(glob), ".txt")
+			if err != nil {
+				http.Error(w, "Bad Glob", http.StatusBadRequest)
+				return
+			}
+			status.MatchCount = len(matches)
+			status.MatchedGlob = status.MatchCount > 0
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}))
+
+	http.HandleFunc("/watch", withAuthReplay(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "Missing ?name= parameter", http.StatusBadRequest)
+			return
+		}
+
+		basePath, err := resolveRoot(r.URL.Query().Get("root"))
+		if err != nil {
+			http.Error(w, "Unknown ?root=", http.StatusBadRequest)
+			return
+		}
+
+		fullPath, err := resolvePath(basePath, name)
+		if err != nil {
+			http.Error(w, "Invalid folder/file name", http.StatusBadRequest)
+			return
+		}
+		info, err := os.Stat(fullPath)
+		if err != nil || !info.IsDir() {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		dw, err := acquireWatcher(fullPath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to watch: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer releaseWatcher(fullPath, dw)
+
+		ch := dw.subscribe()
+		defer dw.unsubscribe(ch)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case ev := <-ch:
+				data, _ := json.Marshal(ev)
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}, false))
+
+	for name, path := range roots {
+		fmt.Printf("Root %q: %s\n", name, path)
+	}
 	fmt.Printf("Listening on http://localhost:%s\n", port)
-	fmt.Printf("Example:\n http://localhost:%s/open?name=.&token=%s\n", port, token)
+	for name := range roots {
+		fmt.Printf("Example:\n http://localhost:%s/open?root=%s&name=.&token=%s\n", port, name, token)
+		break
+	}
 	if err := http.ListenAndServe("localhost:"+port, nil); err != nil {
 		fmt.Println("Server error:", err)
 		os.Exit(1)